@@ -5,8 +5,16 @@ import (
 	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/images/archive"
 	"github.com/containerd/containerd/namespaces"
 	"github.com/distribution/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"io"
+	"io/ioutil"
+	"os"
 	"strings"
 )
 
@@ -31,18 +39,20 @@ func NewRegistryClient() (registry.Client, error) {
 	return c, nil
 }
 
-func (c *RegistryClient) Pull(repo string) (string, error) {
+// Pull implements registry.Client. containerd has no signature-verification
+// hook of its own, so the returned PullResult is always unverified.
+func (c *RegistryClient) Pull(repo string) (registry.PullResult, error) {
 	if named, err := reference.ParseDockerRef(repo); err == nil {
 		repo = named.String()
 	}
 
 	image, err := c.client.Pull(context.Background(), repo, containerd.WithPullUnpack)
 	if err != nil {
-		return "", err
+		return registry.PullResult{}, err
 	}
 
 	imageID := strings.Join([]string{ns, string(image.Target().Digest)}, "/")
-	return imageID, nil
+	return registry.PullResult{Digest: imageID}, nil
 }
 
 func (c *RegistryClient) Remove(repo string) error {
@@ -63,3 +73,116 @@ func (c *RegistryClient) Remove(repo string) error {
 
 	return nil
 }
+
+// List implements registry.Client by returning the name of every image in
+// containerd's local content store whose name has address as a prefix (or
+// every image when address is empty).
+func (c *RegistryClient) List(address string) ([]string, error) {
+	ctx := namespaces.WithNamespace(context.Background(), ns)
+
+	imgs, err := c.client.ImageService().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, img := range imgs {
+		if address == "" || strings.HasPrefix(img.Name, address) {
+			names = append(names, img.Name)
+		}
+	}
+	return names, nil
+}
+
+// Tags implements registry.Client. containerd has no registry catalog of
+// its own, so this lists the tags of repo's images already pulled locally.
+func (c *RegistryClient) Tags(repo string) ([]string, error) {
+	names, err := c.List(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, n := range names {
+		named, err := reference.ParseDockerRef(n)
+		if err != nil {
+			continue
+		}
+		if tagged, ok := named.(reference.Tagged); ok {
+			tags = append(tags, tagged.Tag())
+		}
+	}
+	return tags, nil
+}
+
+// Inspect implements registry.Client by exporting repo as an OCI tarball and
+// decoding it into a v1.Image, the same type the docker and oci backends
+// return. The export is buffered to a temp file rather than streamed
+// straight into tarball.Image: that reads its Opener independently for the
+// manifest, the config blob, and each layer, and a pipe can only be drained
+// once, so a second read would hang or return truncated data for anything
+// beyond a single-layer image. tarball.ImageFromPath reopens the file for
+// each read, the same way the oci backend's own Inspect does.
+func (c *RegistryClient) Inspect(repo string) (v1.Image, error) {
+	if named, err := reference.ParseDockerRef(repo); err == nil {
+		repo = named.String()
+	}
+	ctx := namespaces.WithNamespace(context.Background(), ns)
+
+	f, err := ioutil.TempFile("", "veinmind-containerd-export-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := c.client.Export(ctx, f, archive.WithImage(c.client.ImageService(), repo)); err != nil {
+		return nil, err
+	}
+
+	ref, err := name.ParseReference(repo)
+	if err != nil {
+		return nil, err
+	}
+	return tarball.ImageFromPath(f.Name(), &ref)
+}
+
+// Push implements registry.Client by writing img out as an OCI tarball and
+// importing it into containerd's content store under repo.
+func (c *RegistryClient) Push(repo string, img v1.Image) error {
+	if named, err := reference.ParseDockerRef(repo); err == nil {
+		repo = named.String()
+	}
+	ctx := namespaces.WithNamespace(context.Background(), ns)
+
+	ref, err := name.ParseReference(repo)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(tarball.Write(ref, img, pw))
+	}()
+
+	_, err = c.client.Import(ctx, pr)
+	return err
+}
+
+// Copy implements registry.Client by exporting srcRef to a v1.Image and
+// writing it to dstRef, the bridge veinmind-runner uses to mirror an image
+// it scanned locally to a remote registry without going back through
+// dockerd.
+func (c *RegistryClient) Copy(srcRef, dstRef string, opts registry.CopyOptions) error {
+	img, err := c.Inspect(srcRef)
+	if err != nil {
+		return err
+	}
+
+	dst, err := name.ParseReference(dstRef)
+	if err != nil {
+		return err
+	}
+
+	return remote.Write(dst, img)
+}
@@ -0,0 +1,28 @@
+package docker
+
+import "testing"
+
+func TestParseBearerChallenge(t *testing.T) {
+	header := `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/ubuntu:pull"`
+
+	realm, service, scope, ok := parseBearerChallenge(header)
+	if !ok {
+		t.Fatalf("parseBearerChallenge(%q) ok = false, want true", header)
+	}
+	if realm != "https://auth.docker.io/token" {
+		t.Errorf("realm = %q, want %q", realm, "https://auth.docker.io/token")
+	}
+	if service != "registry.docker.io" {
+		t.Errorf("service = %q, want %q", service, "registry.docker.io")
+	}
+	if scope != "repository:library/ubuntu:pull" {
+		t.Errorf("scope = %q, want %q", scope, "repository:library/ubuntu:pull")
+	}
+}
+
+func TestParseBearerChallengeNotBearer(t *testing.T) {
+	_, _, _, ok := parseBearerChallenge(`Basic realm="registry"`)
+	if ok {
+		t.Error("parseBearerChallenge(Basic) ok = true, want false")
+	}
+}
@@ -3,25 +3,38 @@ package docker
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"github.com/chaitin/libveinmind/go/plugin/log"
 	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry/shortnames"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry/signature"
 	"github.com/distribution/distribution/reference"
 	"github.com/docker/cli/cli/command"
 	"github.com/docker/cli/cli/config/configfile"
 	dockertypes "github.com/docker/docker/api/types"
 	dockercli "github.com/docker/docker/client"
+	credhelper "github.com/docker/docker-credential-helpers/client"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -32,12 +45,372 @@ type Option func(c *RegistryClient) (*RegistryClient, error)
 type Auth struct {
 	Username string
 	Password string
+	// IdentityToken is the refresh token `docker login` receives back from
+	// registries that support it (Docker Hub 2FA, Azure ACR, Harbor OIDC).
+	// When set it is exchanged for a short-lived bearer access token rather
+	// than sending Username/Password.
+	IdentityToken string
+	// RegistryToken is an already-scoped bearer token (as used by some ACR
+	// flows) that can be exchanged the same way as IdentityToken.
+	RegistryToken string
+}
+
+// bearerAccessToken is a cached, short-lived registry access token obtained
+// by exchanging an identity/registry token against a realm.
+type bearerAccessToken struct {
+	token   string
+	expires time.Time
 }
 
 type RegistryClient struct {
-	ctx     context.Context
-	auth    map[string]Auth
-	options []remote.Option
+	ctx context.Context
+	// auth holds credentials resolved once, from WithAuth and from the
+	// plaintext `auth` and identitytoken/registrytoken fields in
+	// config.json.
+	auth map[string]Auth
+	// credHelpers holds, per registry domain, the name of the
+	// docker-credential-helper ("ecr-login", "gcloud", ...) that should be
+	// exec'd to resolve credentials. It takes priority over auth and is
+	// re-queried on every call so short-lived tokens (e.g. ECR) stay fresh.
+	credHelpers map[string]string
+	// bearerTokens caches access tokens obtained from the token-exchange
+	// flow, keyed by registry+scope, so repeated calls don't re-exchange an
+	// identity token until it actually expires.
+	bearerTokens   map[string]bearerAccessToken
+	bearerTokensMu sync.Mutex
+	options        []remote.Option
+	// shortNames resolves unqualified image names (e.g. "nginx") against a
+	// registries.conf-style alias/search-registry config instead of letting
+	// reference.ParseDockerRef silently rewrite them to docker.io/library.
+	// Nil means no resolver is configured and short names pass through
+	// unchanged, as before.
+	shortNames *shortnames.Resolver
+	// verifier checks a pulled image's cosign/Notary-v2 signature against a
+	// trust policy. Nil means Pull does no verification, as before.
+	verifier *signature.Verifier
+}
+
+const (
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	cosignCertAnnotation      = "dev.sigstore.cosign/certificate"
+)
+
+// registryHostFromConfigKey extracts the bare registry host from a
+// config.json auths/credHelpers key, which in practice is either already a
+// bare host ("registry.corp:5000") or a full URL, most commonly Docker Hub's
+// documented "https://index.docker.io/v1/".
+func registryHostFromConfigKey(server string) string {
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" {
+		return server
+	}
+	return u.Host
+}
+
+// authFromHelper execs docker-credential-<helper> get for serverURL and
+// translates the reply into an Auth. It is the shared lookup path used by
+// both the go-containerregistry remote.* calls and dockercli.ImagePull.
+func authFromHelper(helper, serverURL string) (Auth, error) {
+	program := credhelper.NewShellProgramFunc("docker-credential-" + helper)
+	creds, err := credhelper.Get(program, serverURL)
+	if err != nil {
+		return Auth{}, err
+	}
+
+	return Auth{
+		Username: creds.Username,
+		Password: creds.Secret,
+	}, nil
+}
+
+// canonicalRegistryDomain normalizes domain through name.NewRegistry, the
+// same canonicalization client.auth/client.credHelpers are keyed by (see
+// NewRegistryClient and WithAuth). Callers into resolveAuth pass domain as
+// produced by distribution/reference.Domain, which canonicalizes Docker Hub
+// to "docker.io" — a different string than go-containerregistry's
+// "index.docker.io" for the same registry — so looking it up unconverted
+// would silently miss a config.json entry keyed under the latter.
+func canonicalRegistryDomain(domain string) string {
+	reg, err := name.NewRegistry(domain)
+	if err != nil {
+		return domain
+	}
+	return reg.String()
+}
+
+// resolveAuth returns the credentials to use for domain, preferring a
+// credential helper (queried fresh every call) over the static auth parsed
+// from config.json.
+func (client *RegistryClient) resolveAuth(domain string) Auth {
+	domain = canonicalRegistryDomain(domain)
+
+	if helper, ok := client.credHelpers[domain]; ok {
+		auth, err := authFromHelper(helper, domain)
+		if err != nil {
+			log.Error(err)
+		} else {
+			return auth
+		}
+	}
+
+	return client.auth[domain]
+}
+
+var bearerChallengeParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseBearerChallenge extracts realm/service/scope from a
+// `Www-Authenticate: Bearer realm="...",service="...",scope="..."` header,
+// as sent by the registry on a 401.
+func parseBearerChallenge(header string) (realm, service, scope string, ok bool) {
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", "", "", false
+	}
+
+	for _, match := range bearerChallengeParamRe.FindAllStringSubmatch(header, -1) {
+		switch match[1] {
+		case "realm":
+			realm = match[2]
+		case "service":
+			service = match[2]
+		case "scope":
+			scope = match[2]
+		}
+	}
+
+	return realm, service, scope, realm != ""
+}
+
+// challengeFor probes the same repo-scoped endpoint the real operation is
+// about to call, unauthenticated, and reads the Bearer challenge off its
+// 401. Probing the registry-wide /v2/ instead would get back a scope (often
+// empty or catalog-only) that doesn't cover the repository, so registries
+// that enforce repo-scoped tokens (Docker Hub, ACR, Harbor) would 401/403 on
+// the actual request even though the token exchange itself succeeded. An
+// empty repo probes /v2/ for registry-wide operations like GetRepos.
+func challengeFor(domain, repo, action string) (realm, service, scope string, err error) {
+	var resp *http.Response
+	switch {
+	case repo == "":
+		resp, err = http.Get("https://" + domain + "/v2/")
+	case action == "push":
+		resp, err = http.Post("https://"+domain+"/v2/"+repo+"/blobs/uploads/", "", nil)
+	default:
+		resp, err = http.Get("https://" + domain + "/v2/" + repo + "/tags/list")
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	defer resp.Body.Close()
+
+	realm, service, scope, ok := parseBearerChallenge(resp.Header.Get("Www-Authenticate"))
+	if !ok {
+		return "", "", "", errors.New("docker: registry did not present a bearer challenge")
+	}
+
+	return realm, service, scope, nil
+}
+
+type tokenExchangeResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// exchangeToken posts refreshToken (an IdentityToken/RegistryToken) to realm
+// per the OAuth2 refresh flow described by the registry token spec, and
+// caches the resulting short-lived access token per (registry, scope).
+func (client *RegistryClient) exchangeToken(domain, realm, service, scope, refreshToken string) (string, error) {
+	key := domain + "|" + scope
+
+	client.bearerTokensMu.Lock()
+	cached, ok := client.bearerTokens[key]
+	client.bearerTokensMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("service", service)
+	form.Set("scope", scope)
+	form.Set("client_id", "veinmind-runner")
+
+	resp, err := http.PostForm(realm, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tr tokenExchangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", err
+	}
+
+	token := tr.Token
+	if token == "" {
+		token = tr.AccessToken
+	}
+	if token == "" {
+		return "", errors.New("docker: token exchange response had no token")
+	}
+
+	expiresIn := tr.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = 60
+	}
+
+	client.bearerTokensMu.Lock()
+	client.bearerTokens[key] = bearerAccessToken{
+		token:   token,
+		expires: time.Now().Add(time.Duration(expiresIn) * time.Second),
+	}
+	client.bearerTokensMu.Unlock()
+
+	return token, nil
+}
+
+// bearerTokenFor resolves a short-lived registry access token for domain by
+// discovering the Bearer challenge repo/action's own request gets (so the
+// token's scope actually covers it) and exchanging auth's identity/registry
+// token against it.
+func (client *RegistryClient) bearerTokenFor(domain, repo, action string, auth Auth) (string, error) {
+	refreshToken := auth.IdentityToken
+	if refreshToken == "" {
+		refreshToken = auth.RegistryToken
+	}
+	if refreshToken == "" {
+		return "", errors.New("docker: no identity or registry token configured")
+	}
+
+	realm, service, scope, err := challengeFor(domain, repo, action)
+	if err != nil {
+		return "", err
+	}
+
+	return client.exchangeToken(domain, realm, service, scope, refreshToken)
+}
+
+// authOptions turns auth into the remote.Option(s) needed to authenticate
+// against domain for repo (empty for registry-wide operations like
+// GetRepos), preferring a bearer access token (exchanged from an
+// identity/registry token, scoped to repo/action) over plain basic auth.
+func (client *RegistryClient) authOptions(domain, repo, action string, auth Auth) []remote.Option {
+	if auth.IdentityToken != "" || auth.RegistryToken != "" {
+		if token, err := client.bearerTokenFor(domain, repo, action, auth); err == nil {
+			return []remote.Option{remote.WithAuth(&authn.Bearer{Token: token})}
+		} else {
+			log.Error(err)
+		}
+	}
+
+	if auth.Username != "" && auth.Password != "" {
+		return []remote.Option{remote.WithAuth(&authn.Basic{
+			Username: auth.Username,
+			Password: auth.Password,
+		})}
+	}
+
+	return nil
+}
+
+// retryTransport wraps a base http.RoundTripper with exponential backoff and
+// jitter on 429/5xx responses, honoring Retry-After when the server sends
+// one. It backs every remote.* call (GetRepo, GetRepoTags, GetRepos, Push,
+// Copy) plus Pull's docker engine client, so walking thousands of images
+// survives rate limits and flaky networks.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+}
+
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	return &retryTransport{base: base, maxRetries: 5}
+}
+
+// newRetryingDockerClient builds a docker engine client the same way
+// dockercli.FromEnv does (host, TLS, API version negotiation — including the
+// unix-socket dialer for the default unix:///var/run/docker.sock host) and
+// then wraps its already-resolved transport with retry/backoff, rather than
+// replacing the whole *http.Client with one built on a bare
+// http.DefaultTransport. Applying WithHTTPClient(bare transport) after
+// FromEnv would throw away FromEnv's host/TLS wiring and break the common
+// case of a default unix-socket daemon.
+func newRetryingDockerClient() (*dockercli.Client, error) {
+	base, err := dockercli.NewClientWithOpts(dockercli.FromEnv, dockercli.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := *base.HTTPClient()
+	httpClient.Transport = newRetryTransport(httpClient.Transport)
+
+	return dockercli.NewClientWithOpts(
+		dockercli.FromEnv,
+		dockercli.WithAPIVersionNegotiation(),
+		dockercli.WithHTTPClient(&httpClient),
+	)
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := 500 * time.Millisecond
+	const maxBackoff = 30 * time.Second
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+		// A non-nil, non-rewindable body (a streaming upload from Push/Copy,
+		// say) was already consumed by this attempt, so retrying would
+		// silently resend a truncated/empty body instead of the real one —
+		// worse than not retrying at all. Return the failed response as-is.
+		if attempt >= t.maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		wait := retryDelay(resp.Header.Get("Retry-After"), backoff)
+		resp.Body.Close()
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// retryDelay honors a Retry-After header (seconds or HTTP-date) when present,
+// otherwise returns a full-jitter backoff in [backoff/2, backoff*1.5).
+func retryDelay(retryAfter string, backoff time.Duration) time.Duration {
+	if retryAfter != "" {
+		if secs, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+		if at, err := http.ParseTime(retryAfter); err == nil {
+			if d := time.Until(at); d > 0 {
+				return d
+			}
+		}
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
 }
 
 func WithAuth(address string, auth Auth) Option {
@@ -52,10 +425,33 @@ func WithAuth(address string, auth Auth) Option {
 	}
 }
 
+// WithShortNames configures how unqualified image names ("nginx") are
+// expanded, per resolver's loaded registries.conf-style config, instead of
+// falling through to reference.ParseDockerRef's unconditional docker.io
+// rewrite.
+func WithShortNames(resolver *shortnames.Resolver) Option {
+	return func(c *RegistryClient) (*RegistryClient, error) {
+		c.shortNames = resolver
+		return c, nil
+	}
+}
+
+// WithSignatureVerification gates Pull on verifier: an image whose signature
+// doesn't validate against verifier's policy is removed again rather than
+// left pulled.
+func WithSignatureVerification(verifier *signature.Verifier) Option {
+	return func(c *RegistryClient) (*RegistryClient, error) {
+		c.verifier = verifier
+		return c, nil
+	}
+}
+
 func NewRegistryClient(opts ...Option) (registry.Client, error) {
 	c := &RegistryClient{}
 	c.ctx = context.Background()
 	c.auth = make(map[string]Auth)
+	c.credHelpers = make(map[string]string)
+	c.bearerTokens = make(map[string]bearerAccessToken)
 
 	// Options handle
 	for _, opt := range opts {
@@ -77,15 +473,7 @@ func NewRegistryClient(opts ...Option) (registry.Client, error) {
 				log.Error(err)
 			} else {
 				for server, config := range dockerConfig.AuthConfigs {
-					u, err := url.Parse(server)
-					registryName := ""
-					if err != nil {
-						registryName = server
-					} else {
-						registryName = u.Host
-					}
-
-					registry, err := name.NewRegistry(registryName)
+					registry, err := name.NewRegistry(registryHostFromConfigKey(server))
 					if err != nil {
 						log.Error(err)
 						continue
@@ -108,6 +496,35 @@ func NewRegistryClient(opts ...Option) (registry.Client, error) {
 							log.Error(err)
 						}
 					}
+
+					// `docker login` stores an identitytoken instead of (or
+					// alongside) auth when the registry returned one, e.g.
+					// Docker Hub 2FA, Azure ACR, Harbor OIDC.
+					if config.IdentityToken != "" || config.RegistryToken != "" {
+						auth := c.auth[registry.String()]
+						auth.IdentityToken = config.IdentityToken
+						auth.RegistryToken = config.RegistryToken
+						c.auth[registry.String()] = auth
+					}
+
+					// A per-registry credHelpers entry wins over the global
+					// credsStore.
+					if helper, ok := dockerConfig.CredentialHelpers[server]; ok {
+						c.credHelpers[registry.String()] = helper
+					} else if dockerConfig.CredentialsStore != "" {
+						c.credHelpers[registry.String()] = dockerConfig.CredentialsStore
+					}
+				}
+
+				// credHelpers may list registries that have no entry under
+				// auths at all.
+				for server, helper := range dockerConfig.CredentialHelpers {
+					registry, err := name.NewRegistry(registryHostFromConfigKey(server))
+					if err != nil {
+						log.Error(err)
+						continue
+					}
+					c.credHelpers[registry.String()] = helper
 				}
 			}
 		} else {
@@ -118,7 +535,7 @@ func NewRegistryClient(opts ...Option) (registry.Client, error) {
 	}
 
 	var clientOpts []remote.Option
-	clientOpts = append(clientOpts, remote.WithTransport(&http.Transport{
+	clientOpts = append(clientOpts, remote.WithTransport(newRetryTransport(&http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
 			Timeout:   5 * time.Second,
@@ -132,31 +549,43 @@ func NewRegistryClient(opts ...Option) (registry.Client, error) {
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 		},
-	}))
+	})))
 	c.options = clientOpts
 
 	return c, nil
 }
 
+// resolveShortName expands repo through the configured shortnames resolver
+// (preferring a resolution previously Record-ed by Pull) before it ever
+// reaches reference.ParseDockerRef. With no resolver configured it returns
+// repo unchanged.
+func (client *RegistryClient) resolveShortName(repo string) (string, error) {
+	if client.shortNames == nil {
+		return repo, nil
+	}
+
+	candidates, err := client.shortNames.Candidates(repo)
+	if err != nil {
+		return "", err
+	}
+	return candidates[0], nil
+}
+
 func (client *RegistryClient) GetRepo(repo string, options ...remote.Option) (*remote.Descriptor, error) {
 	options = append(options, client.options...)
-	named, err := reference.ParseDockerRef(repo)
+	repo, err := client.resolveShortName(repo)
 	if err != nil {
 		return nil, err
 	}
 
-	domain := reference.Domain(named)
-	var auth Auth
-	if v, ok := client.auth[domain]; ok {
-		auth = v
+	named, err := reference.ParseDockerRef(repo)
+	if err != nil {
+		return nil, err
 	}
 
-	if auth.Username != "" && auth.Password != "" {
-		options = append(options, remote.WithAuth(&authn.Basic{
-			Username: auth.Username,
-			Password: auth.Password,
-		}))
-	}
+	domain := reference.Domain(named)
+	auth := client.resolveAuth(domain)
+	options = append(options, client.authOptions(domain, reference.Path(named), "pull", auth)...)
 
 	ref, err := name.ParseReference(repo)
 	if err != nil {
@@ -167,23 +596,19 @@ func (client *RegistryClient) GetRepo(repo string, options ...remote.Option) (*r
 
 func (client *RegistryClient) GetRepoTags(repo string, options ...remote.Option) ([]string, error) {
 	options = append(options, client.options...)
-	named, err := reference.ParseDockerRef(repo)
+	repo, err := client.resolveShortName(repo)
 	if err != nil {
 		return nil, err
 	}
 
-	domain := reference.Domain(named)
-	var auth Auth
-	if v, ok := client.auth[domain]; ok {
-		auth = v
+	named, err := reference.ParseDockerRef(repo)
+	if err != nil {
+		return nil, err
 	}
 
-	if auth.Username != "" && auth.Password != "" {
-		options = append(options, remote.WithAuth(&authn.Basic{
-			Username: auth.Username,
-			Password: auth.Password,
-		}))
-	}
+	domain := reference.Domain(named)
+	auth := client.resolveAuth(domain)
+	options = append(options, client.authOptions(domain, reference.Path(named), "pull", auth)...)
 
 	repoR, err := name.NewRepository(repo)
 	if err != nil {
@@ -192,66 +617,285 @@ func (client *RegistryClient) GetRepoTags(repo string, options ...remote.Option)
 	return remote.List(repoR, options...)
 }
 
-func (client *RegistryClient) GetRepos(address string, options ...remote.Option) (repos []string, err error) {
-	options = append(options, client.options...)
-	var auth Auth
-	if v, ok := client.auth[address]; ok {
-		auth = v
-	}
+// ResumeStore checkpoints a registry catalog walk's cursor so an interrupted
+// GetRepos can resume where it left off instead of starting over.
+type ResumeStore interface {
+	Load(ctx context.Context, registry string) (last string, ok bool, err error)
+	Save(ctx context.Context, registry, last string) error
+}
 
-	if auth.Username != "" && auth.Password != "" {
-		options = append(options, remote.WithAuth(&authn.Basic{
-			Username: auth.Username,
-			Password: auth.Password,
-		}))
-	}
+// CatalogOptions configures GetRepos's catalog walk and GetReposTags's
+// concurrent tag enumeration.
+type CatalogOptions struct {
+	// PageSize is the catalog page size requested per call. Defaults to
+	// 1000 when <= 0.
+	PageSize int
+	// Concurrency bounds how many repos GetReposTags lists tags for at
+	// once. Defaults to 10 when <= 0.
+	Concurrency int
+	// Filter, when set, drops repos for which it returns false.
+	Filter func(repo string) bool
+	// Resume, when set, checkpoints the cursor after every page so an
+	// interrupted walk can pick back up.
+	Resume ResumeStore
+}
+
+func (client *RegistryClient) GetRepos(ctx context.Context, address string, opts CatalogOptions) (repos []string, err error) {
+	options := append([]remote.Option{remote.WithContext(ctx)}, client.options...)
+	options = append(options, client.authOptions(address, "", "", client.resolveAuth(address))...)
 
 	regsitry, err := name.NewRegistry(address)
 	if err != nil {
 		return nil, err
 	}
 
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+
 	last := ""
+	if opts.Resume != nil {
+		if v, ok, lerr := opts.Resume.Load(ctx, regsitry.String()); lerr != nil {
+			log.Error(lerr)
+		} else if ok {
+			last = v
+		}
+	}
+
 	for {
-		reposTemp := []string{}
-		reposTemp, err = remote.CatalogPage(regsitry, last, 10000, options...)
-		if err != nil {
+		page, perr := remote.CatalogPage(regsitry, last, pageSize, options...)
+		if perr != nil {
+			return repos, perr
+		}
+		if len(page) == 0 {
 			break
 		}
 
-		if len(reposTemp) > 0 {
-			repos = append(repos, reposTemp...)
-		} else {
-			break
+		for _, repo := range page {
+			if opts.Filter == nil || opts.Filter(repo) {
+				repos = append(repos, repo)
+			}
 		}
 
-		last = reposTemp[len(reposTemp)-1]
+		last = page[len(page)-1]
+		if opts.Resume != nil {
+			if serr := opts.Resume.Save(ctx, regsitry.String(), last); serr != nil {
+				log.Error(serr)
+			}
+		}
 	}
 
-	return repos, err
+	return repos, nil
 }
 
-func (client *RegistryClient) Pull(repo string) (string, error) {
-	c, err := dockercli.NewClientWithOpts(dockercli.FromEnv, dockercli.WithAPIVersionNegotiation())
+// RepoTags pairs a repository with the result of listing its tags, as
+// streamed by GetReposTags.
+type RepoTags struct {
+	Repo string
+	Tags []string
+	Err  error
+}
+
+// GetReposTags fans repos out across a bounded worker pool (opts.Concurrency)
+// and streams each repo's GetRepoTags result back on the returned channel as
+// it completes, not in input order. The channel is closed once every repo
+// has been processed or ctx is done.
+func (client *RegistryClient) GetReposTags(ctx context.Context, repos []string, opts CatalogOptions) <-chan RepoTags {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	jobs := make(chan string)
+	out := make(chan RepoTags)
+
+	var workers sync.WaitGroup
+	workers.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer workers.Done()
+			for repo := range jobs {
+				tags, err := client.GetRepoTags(repo, remote.WithContext(ctx))
+				select {
+				case out <- RepoTags{Repo: repo, Tags: tags, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, repo := range repos {
+			select {
+			case jobs <- repo:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		workers.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// List implements registry.Client by returning the catalog of address, the
+// same as GetRepos.
+func (client *RegistryClient) List(address string) ([]string, error) {
+	return client.GetRepos(client.ctx, address, CatalogOptions{})
+}
+
+// Tags implements registry.Client by returning repo's tags, the same as
+// GetRepoTags.
+func (client *RegistryClient) Tags(repo string) ([]string, error) {
+	return client.GetRepoTags(repo)
+}
+
+// Inspect implements registry.Client by fetching repo's manifest and
+// resolving it to a v1.Image.
+func (client *RegistryClient) Inspect(repo string) (v1.Image, error) {
+	desc, err := client.GetRepo(repo)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return desc.Image()
+}
 
+// Push implements registry.Client by writing img's manifest and blobs to
+// repo.
+func (client *RegistryClient) Push(repo string, img v1.Image) error {
+	options := append([]remote.Option{}, client.options...)
 	named, err := reference.ParseDockerRef(repo)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	domain := reference.Domain(named)
-	var auth Auth
-	if v, ok := client.auth[domain]; ok {
-		auth = v
+	options = append(options, client.authOptions(domain, reference.Path(named), "push", client.resolveAuth(domain))...)
+
+	ref, err := name.ParseReference(repo)
+	if err != nil {
+		return err
+	}
+	return remote.Write(ref, img, options...)
+}
+
+// Copy streams srcRef straight to dstRef via remote.Write/remote.WriteIndex,
+// so blobs already present at the destination (including via cross-repo
+// mount within the same registry) are not re-downloaded, and the original
+// manifest digest is preserved. Unless opts.AllArchitectures is set, a
+// multi-arch index is resolved down to the current runtime's platform
+// before being copied.
+func (client *RegistryClient) Copy(srcRef, dstRef string, opts registry.CopyOptions) error {
+	srcNamed, err := reference.ParseDockerRef(srcRef)
+	if err != nil {
+		return err
+	}
+	srcDomain := reference.Domain(srcNamed)
+	srcOptions := append([]remote.Option{}, client.options...)
+	srcOptions = append(srcOptions, client.authOptions(srcDomain, reference.Path(srcNamed), "pull", client.resolveAuth(srcDomain))...)
+	if !opts.AllArchitectures {
+		srcOptions = append(srcOptions, remote.WithPlatform(v1.Platform{
+			OS:           runtime.GOOS,
+			Architecture: runtime.GOARCH,
+		}))
+	}
+
+	src, err := name.ParseReference(srcRef)
+	if err != nil {
+		return err
+	}
+
+	desc, err := remote.Get(src, srcOptions...)
+	if err != nil {
+		return err
+	}
+
+	dstNamed, err := reference.ParseDockerRef(dstRef)
+	if err != nil {
+		return err
+	}
+	dstDomain := reference.Domain(dstNamed)
+	dstOptions := append([]remote.Option{}, client.options...)
+	dstOptions = append(dstOptions, client.authOptions(dstDomain, reference.Path(dstNamed), "push", client.resolveAuth(dstDomain))...)
+
+	dst, err := name.ParseReference(dstRef)
+	if err != nil {
+		return err
+	}
+
+	if desc.MediaType.IsIndex() && opts.AllArchitectures {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+		return remote.WriteIndex(dst, idx, dstOptions...)
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return err
+	}
+	return remote.Write(dst, img, dstOptions...)
+}
+
+// Pull expands repo through the configured shortnames resolver and, in
+// permissive mode, tries each candidate registry in order until one pulls
+// successfully, recording the winner so later Remove/GetRepo calls for the
+// same short name reuse it.
+func (client *RegistryClient) Pull(repo string) (registry.PullResult, error) {
+	if client.shortNames == nil {
+		return client.pullOne(repo)
 	}
 
-	// Generate Auth Token
+	candidates, err := client.shortNames.Candidates(repo)
+	if err != nil {
+		return registry.PullResult{}, err
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		result, err := client.pullOne(candidate)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		client.shortNames.Record(repo, candidate)
+		return result, nil
+	}
+
+	return registry.PullResult{}, lastErr
+}
+
+func (client *RegistryClient) pullOne(repo string) (registry.PullResult, error) {
+	c, err := newRetryingDockerClient()
+	if err != nil {
+		return registry.PullResult{}, err
+	}
+
+	named, err := reference.ParseDockerRef(repo)
+	if err != nil {
+		return registry.PullResult{}, err
+	}
+
+	domain := reference.Domain(named)
+	auth := client.resolveAuth(domain)
+
+	// Generate Auth Token. The daemon prefers IdentityToken/RegistryToken
+	// over Username/Password when present, refreshing them itself.
 	token, err := command.EncodeAuthToBase64(dockertypes.AuthConfig{
-		Username: auth.Username,
-		Password: auth.Password})
+		Username:      auth.Username,
+		Password:      auth.Password,
+		IdentityToken: auth.IdentityToken,
+		RegistryToken: auth.RegistryToken,
+	})
 
 	var closer io.ReadCloser
 	if token == "" {
@@ -261,16 +905,134 @@ func (client *RegistryClient) Pull(repo string) (string, error) {
 			RegistryAuth: token,
 		})
 	}
+	if err != nil {
+		return registry.PullResult{}, err
+	}
 
 	_, err = ioutil.ReadAll(closer)
 	if err != nil {
-		return "", err
+		return registry.PullResult{}, err
+	}
+
+	result := registry.PullResult{Digest: named.String()}
+	if client.verifier == nil {
+		return result, nil
 	}
 
-	return named.String(), nil
+	return client.verifySignature(named, repo, result)
+}
+
+// verifySignature resolves repo's manifest digest, fetches its
+// sha256-<digest>.sig signatures and checks them against client.verifier's
+// policy, removing the image dockerd just pulled when no signature
+// validates. It is only reached when client.verifier is non-nil.
+func (client *RegistryClient) verifySignature(named reference.Named, repo string, result registry.PullResult) (registry.PullResult, error) {
+	desc, err := client.GetRepo(repo)
+	if err != nil {
+		client.removeUnverified(named.String())
+		return result, fmt.Errorf("signature: resolving digest for %s: %w", repo, err)
+	}
+	result.Digest = desc.Digest.String()
+
+	sigs, err := client.fetchSignatures(repo, desc.Digest.Hex)
+	if err != nil {
+		client.removeUnverified(named.String())
+		return result, fmt.Errorf("signature: fetching signatures for %s: %w", repo, err)
+	}
+
+	signedBy, err := client.verifier.Verify(reference.Domain(named)+"/"+reference.Path(named), desc.Digest.String(), sigs)
+	if err != nil {
+		client.removeUnverified(named.String())
+		return result, fmt.Errorf("signature: %s failed verification: %w", repo, err)
+	}
+
+	result.Verified = true
+	result.SignedBy = signedBy
+	return result, nil
+}
+
+// removeUnverified best-effort removes an image Pull already fetched once
+// its signature fails to verify, logging rather than returning a second
+// error alongside the verification failure that's already being reported.
+func (client *RegistryClient) removeUnverified(id string) {
+	if err := client.Remove(id); err != nil {
+		log.Error(fmt.Errorf("signature: removing unverified image %s: %w", id, err))
+	}
+}
+
+// fetchSignatures pulls repo's cosign-convention signature tag
+// (sha256-<digest>.sig) and decodes each annotated layer into a
+// signature.Signature.
+func (client *RegistryClient) fetchSignatures(repo, digestHex string) ([]signature.Signature, error) {
+	named, err := reference.ParseDockerRef(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	sigRepo := fmt.Sprintf("%s/%s:sha256-%s.sig", reference.Domain(named), reference.Path(named), digestHex)
+	ref, err := name.ParseReference(sigRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := reference.Domain(named)
+	auth := client.resolveAuth(domain)
+	options := append(append([]remote.Option{}, client.options...), client.authOptions(domain, reference.Path(named), "pull", auth)...)
+
+	img, err := remote.Image(ref, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	var sigs []signature.Signature
+	for i, layerDesc := range manifest.Layers {
+		b64Sig, ok := layerDesc.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		sigBytes, err := base64.StdEncoding.DecodeString(b64Sig)
+		if err != nil {
+			continue
+		}
+
+		rc, err := layers[i].Uncompressed()
+		if err != nil {
+			continue
+		}
+		payload, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			continue
+		}
+
+		sig := signature.Signature{Payload: payload, Sig: sigBytes}
+		if certPEM, ok := layerDesc.Annotations[cosignCertAnnotation]; ok {
+			if block, _ := pem.Decode([]byte(certPEM)); block != nil {
+				if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+					sig.Cert = cert
+				}
+			}
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
 }
 
 func (client *RegistryClient) Remove(id string) error {
+	id, err := client.resolveShortName(id)
+	if err != nil {
+		return err
+	}
+
 	c, err := dockercli.NewClientWithOpts(dockercli.FromEnv, dockercli.WithAPIVersionNegotiation())
 	if err != nil {
 		return err
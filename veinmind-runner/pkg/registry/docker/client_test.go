@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"log"
 	"testing"
 )
@@ -12,7 +13,7 @@ func TestList(t *testing.T) {
 	}
 	switch v := c.(type) {
 	case *RegistryClient:
-		log.Println(v.GetRepos("127.0.0.1:5000"))
+		log.Println(v.GetRepos(context.Background(), "127.0.0.1:5000", CatalogOptions{}))
 		d, err := v.GetRepo("ubuntu")
 		m, _ := d.RawManifest()
 		log.Println(string(m), err)
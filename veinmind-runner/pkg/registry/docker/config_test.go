@@ -0,0 +1,43 @@
+package docker
+
+import "testing"
+
+func TestRegistryHostFromConfigKey(t *testing.T) {
+	cases := []struct {
+		server string
+		want   string
+	}{
+		{"https://index.docker.io/v1/", "index.docker.io"},
+		{"registry.corp:5000", "registry.corp:5000"},
+		{"https://registry.corp:5000", "registry.corp:5000"},
+		{"localhost:5000", "localhost:5000"},
+	}
+
+	for _, c := range cases {
+		if got := registryHostFromConfigKey(c.server); got != c.want {
+			t.Errorf("registryHostFromConfigKey(%q) = %q, want %q", c.server, got, c.want)
+		}
+	}
+}
+
+func TestCanonicalRegistryDomainMatchesConfigKeyLookup(t *testing.T) {
+	// reference.Domain(named) returns "docker.io" for an unqualified or
+	// docker.io ref, while name.NewRegistry(...).String() (used to key
+	// client.auth/client.credHelpers) canonicalizes the same registry to
+	// "index.docker.io". resolveAuth must bridge the two, or a config.json
+	// entry for Docker Hub is never found.
+	cases := []struct {
+		domain string
+		want   string
+	}{
+		{"docker.io", "index.docker.io"},
+		{"index.docker.io", "index.docker.io"},
+		{"registry.corp:5000", "registry.corp:5000"},
+	}
+
+	for _, c := range cases {
+		if got := canonicalRegistryDomain(c.domain); got != c.want {
+			t.Errorf("canonicalRegistryDomain(%q) = %q, want %q", c.domain, got, c.want)
+		}
+	}
+}
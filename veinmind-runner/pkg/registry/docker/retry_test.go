@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryDelayHonorsRetryAfterSeconds(t *testing.T) {
+	d := retryDelay("2", time.Second)
+	if d != 2*time.Second {
+		t.Errorf("retryDelay(%q, ...) = %v, want %v", "2", d, 2*time.Second)
+	}
+}
+
+func TestRetryDelayHonorsRetryAfterHTTPDate(t *testing.T) {
+	future := time.Now().Add(10 * time.Second)
+	d := retryDelay(future.UTC().Format(http.TimeFormat), time.Second)
+	if d <= 0 || d > 10*time.Second {
+		t.Errorf("retryDelay(%q, ...) = %v, want within (0, 10s]", future, d)
+	}
+}
+
+func TestRetryDelayFallsBackToJitteredBackoff(t *testing.T) {
+	backoff := 2 * time.Second
+	d := retryDelay("", backoff)
+	if d < backoff/2 || d >= backoff/2+backoff {
+		t.Errorf("retryDelay(\"\", %v) = %v, want within [%v, %v)", backoff, d, backoff/2, backoff/2+backoff)
+	}
+}
+
+func TestRoundTripRetriesAndRewindsRewindableBody(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("request %d body = %q, want %q", requests, body, "payload")
+		}
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	rt := newRetryTransport(http.DefaultTransport)
+	rt.maxRetries = 5
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("final status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if requests != 3 {
+		t.Errorf("server saw %d requests, want 3", requests)
+	}
+}
+
+func TestRoundTripDoesNotRetryNonRewindableBody(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	rt := newRetryTransport(http.DefaultTransport)
+	rt.maxRetries = 5
+
+	// A plain io.Reader (not bytes.Reader/strings.Reader/bytes.Buffer) gives
+	// http.NewRequest no way to fill in GetBody, the same as a streaming
+	// upload body from Push/Copy.
+	req, err := http.NewRequest(http.MethodPut, srv.URL, ioutil.NopCloser(bytes.NewBufferString("payload")))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.GetBody = nil
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if requests != 1 {
+		t.Errorf("server saw %d requests, want 1 (no retry on non-rewindable body)", requests)
+	}
+}
@@ -0,0 +1,152 @@
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"strings"
+)
+
+const refNameAnnotation = "org.opencontainers.image.ref.name"
+
+// RegistryClient is a registry.Client backed by a local OCI image-layout
+// directory (as produced by `skopeo copy`/`crane pull --format=oci`) or a
+// single-image `.tar` (as produced by `docker save`/`crane pull`). It lets
+// veinmind-runner scan an image once and stage it on disk, or mirror it
+// between backends, without a registry in between.
+type RegistryClient struct {
+	// path is the image-layout directory, or .tar file, this client reads
+	// from and writes to.
+	path string
+}
+
+func NewRegistryClient(path string) (registry.Client, error) {
+	return &RegistryClient{path: path}, nil
+}
+
+func (c *RegistryClient) isTar() bool {
+	return strings.HasSuffix(c.path, ".tar")
+}
+
+// Pull implements registry.Client. A local layout/tar has no registry to
+// fetch a signature from, so the returned PullResult is always unverified.
+func (c *RegistryClient) Pull(repo string) (registry.PullResult, error) {
+	img, err := c.Inspect(repo)
+	if err != nil {
+		return registry.PullResult{}, err
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return registry.PullResult{}, err
+	}
+	return registry.PullResult{Digest: digest.String()}, nil
+}
+
+func (c *RegistryClient) Remove(id string) error {
+	return errors.New("oci: removing a single image from a layout is not supported, delete the path instead")
+}
+
+func (c *RegistryClient) List(address string) ([]string, error) {
+	if c.isTar() {
+		return nil, errors.New("oci: listing images in a .tar is not supported")
+	}
+
+	p, err := layout.FromPath(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for _, m := range manifest.Manifests {
+		if ref, ok := m.Annotations[refNameAnnotation]; ok && (address == "" || strings.HasPrefix(ref, address)) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+func (c *RegistryClient) Tags(repo string) ([]string, error) {
+	return c.List(repo)
+}
+
+func (c *RegistryClient) Inspect(repo string) (v1.Image, error) {
+	if c.isTar() {
+		ref, err := name.ParseReference(repo)
+		if err != nil {
+			return nil, err
+		}
+		return tarball.ImageFromPath(c.path, &ref)
+	}
+
+	p, err := layout.FromPath(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range manifest.Manifests {
+		if m.Annotations[refNameAnnotation] == repo {
+			return idx.Image(m.Digest)
+		}
+	}
+	return nil, fmt.Errorf("oci: %s not found in %s", repo, c.path)
+}
+
+// Push implements registry.Client by appending img to the layout (tagging
+// it with repo via the standard ref-name annotation), or overwriting the
+// single-image .tar.
+func (c *RegistryClient) Push(repo string, img v1.Image) error {
+	if c.isTar() {
+		ref, err := name.ParseReference(repo)
+		if err != nil {
+			return err
+		}
+		return tarball.WriteToFile(c.path, ref, img)
+	}
+
+	p, err := layout.FromPath(c.path)
+	if err != nil {
+		p, err = layout.Write(c.path, empty.Index)
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.AppendImage(img, layout.WithAnnotations(map[string]string{
+		refNameAnnotation: repo,
+	}))
+}
+
+// Copy implements registry.Client by reading srcRef out of this layout/tar
+// and writing it back under dstRef, e.g. to re-tag an image on disk before
+// pushing it elsewhere.
+func (c *RegistryClient) Copy(srcRef, dstRef string, opts registry.CopyOptions) error {
+	img, err := c.Inspect(srcRef)
+	if err != nil {
+		return err
+	}
+	return c.Push(dstRef, img)
+}
@@ -0,0 +1,63 @@
+package oci
+
+import (
+	"testing"
+
+	"github.com/chaitin/veinmind-tools/veinmind-runner/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+func TestIsTar(t *testing.T) {
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"/tmp/image.tar", true},
+		{"/tmp/layout", false},
+		{"/tmp/layout/", false},
+	}
+
+	for _, c := range cases {
+		client := &RegistryClient{path: c.path}
+		if got := client.isTar(); got != c.want {
+			t.Errorf("isTar(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestPushAndCopyLayout(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := layout.Write(dir, empty.Index); err != nil {
+		t.Fatalf("layout.Write: %v", err)
+	}
+
+	c, err := NewRegistryClient(dir)
+	if err != nil {
+		t.Fatalf("NewRegistryClient: %v", err)
+	}
+
+	if err := c.Push("repo:latest", empty.Image); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	tags, err := c.List("")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(tags) != 1 || tags[0] != "repo:latest" {
+		t.Fatalf("List() = %v, want [repo:latest]", tags)
+	}
+
+	if err := c.Copy("repo:latest", "repo:copied", registry.CopyOptions{}); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+
+	tags, err = c.List("")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(tags) != 2 {
+		t.Fatalf("List() after Copy = %v, want 2 tags", tags)
+	}
+}
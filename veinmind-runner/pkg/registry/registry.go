@@ -0,0 +1,47 @@
+package registry
+
+import v1 "github.com/google/go-containerregistry/pkg/v1"
+
+// Client is the common interface implemented by every registry backend
+// (docker, containerd, oci, ...) so that callers in veinmind-runner can
+// pull, push, inspect and mirror images without depending on a specific
+// container engine.
+type Client interface {
+	Pull(repo string) (PullResult, error)
+	Push(repo string, img v1.Image) error
+	Remove(id string) error
+	List(address string) ([]string, error)
+	Tags(repo string) ([]string, error)
+	Inspect(repo string) (v1.Image, error)
+	Copy(srcRef, dstRef string, opts CopyOptions) error
+}
+
+// PullResult is what Pull resolves a repo to, plus whatever a configured
+// signature.Verifier was able to establish about it. Verified is false and
+// SignedBy is empty whenever a backend has no verifier configured, or
+// doesn't support signature verification at all.
+type PullResult struct {
+	// Digest is the pulled image's manifest digest. The containerd backend
+	// prefixes it with its namespace ("veinmind-runner/sha256:..."), and the
+	// docker backend reports the normalized reference (e.g.
+	// "docker.io/library/nginx:latest") rather than a digest when it has no
+	// verifier configured.
+	Digest string
+	// Verified reports whether Digest's signature was checked against a
+	// policy rule and found valid.
+	Verified bool
+	// SignedBy identifies the signer a valid signature was attributed to:
+	// "key:" followed by the matching rule's pattern in key mode, or the
+	// certificate's identity (its first URI or email SAN) in keyless mode.
+	SignedBy string
+}
+
+// CopyOptions configures Copy between two registry.Client-addressable
+// references, which may belong to different backends (a docker registry, a
+// containerd content store, or an OCI image-layout directory/tar).
+type CopyOptions struct {
+	// AllArchitectures copies every platform of a multi-arch manifest list.
+	// When false, Copy resolves the source down to the current runtime's
+	// platform before copying.
+	AllArchitectures bool
+}
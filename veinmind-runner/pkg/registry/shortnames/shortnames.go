@@ -0,0 +1,135 @@
+// Package shortnames resolves unqualified ("short") image names the way
+// containers/image's registries.conf does, so air-gapped or mirrored
+// environments don't silently get nginx rewritten to docker.io/library/nginx.
+package shortnames
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"strings"
+	"sync"
+)
+
+// Mode controls how a Resolver handles a short name it has no recorded
+// resolution for.
+type Mode string
+
+const (
+	// ModeEnforcing refuses to guess: a short name must have an explicit
+	// alias, otherwise Candidates errors.
+	ModeEnforcing Mode = "enforcing"
+	// ModePermissive tries each UnqualifiedSearchRegistries entry in order
+	// when there's no alias.
+	ModePermissive Mode = "permissive"
+	// ModeDisabled leaves short names untouched, the same behavior as
+	// reference.ParseDockerRef's unconditional docker.io/library rewrite.
+	ModeDisabled Mode = "disabled"
+)
+
+// Config is the on-disk shape of a registries.conf-style TOML file, e.g.
+//
+//	mode = "permissive"
+//	unqualified-search-registries = ["mirror.corp", "docker.io"]
+//
+//	[aliases]
+//	"nginx" = "mirror.corp/library/nginx"
+type Config struct {
+	Mode                        Mode              `toml:"mode"`
+	UnqualifiedSearchRegistries []string          `toml:"unqualified-search-registries"`
+	Aliases                     map[string]string `toml:"aliases"`
+}
+
+// Resolver expands short names into fully-qualified references per a loaded
+// Config, and remembers which candidate was picked for a given short name so
+// later calls against the same name (Remove, GetRepo, after a successful
+// Pull) reuse it instead of re-running the search.
+type Resolver struct {
+	mode                        Mode
+	aliases                     map[string]string
+	unqualifiedSearchRegistries []string
+
+	resolvedMu sync.Mutex
+	resolved   map[string]string
+}
+
+// Load reads a registries.conf-style TOML file from path.
+func Load(path string) (*Resolver, error) {
+	var cfg Config
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		return nil, err
+	}
+	return New(cfg), nil
+}
+
+// New builds a Resolver from an already-parsed Config.
+func New(cfg Config) *Resolver {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = ModePermissive
+	}
+
+	return &Resolver{
+		mode:                        mode,
+		aliases:                     cfg.Aliases,
+		unqualifiedSearchRegistries: cfg.UnqualifiedSearchRegistries,
+		resolved:                    make(map[string]string),
+	}
+}
+
+// IsShortName reports whether repo has no registry component, i.e. it's the
+// kind of name reference.ParseDockerRef would otherwise silently rewrite
+// against docker.io/library.
+func IsShortName(repo string) bool {
+	first := strings.SplitN(repo, "/", 2)[0]
+	return first != "localhost" && !strings.ContainsAny(first, ".:")
+}
+
+// Candidates returns repo's expansion candidates from the first source that
+// has any: a previously Record-ed resolution, else a configured alias, else
+// each unqualified-search-registries entry in order. It does no network
+// I/O; callers try
+// each candidate in turn (e.g. attempting a Pull) and call Record once one
+// succeeds.
+func (r *Resolver) Candidates(repo string) ([]string, error) {
+	if r == nil || r.mode == ModeDisabled || !IsShortName(repo) {
+		return []string{repo}, nil
+	}
+
+	r.resolvedMu.Lock()
+	resolved, ok := r.resolved[repo]
+	r.resolvedMu.Unlock()
+	if ok {
+		return []string{resolved}, nil
+	}
+
+	if alias, ok := r.aliases[repo]; ok {
+		return []string{alias}, nil
+	}
+
+	if r.mode == ModeEnforcing {
+		return nil, fmt.Errorf("shortnames: %q is ambiguous and has no alias configured (enforcing mode)", repo)
+	}
+
+	if len(r.unqualifiedSearchRegistries) == 0 {
+		return nil, fmt.Errorf("shortnames: %q is ambiguous and no unqualified-search-registries are configured", repo)
+	}
+
+	candidates := make([]string, len(r.unqualifiedSearchRegistries))
+	for i, reg := range r.unqualifiedSearchRegistries {
+		candidates[i] = reg + "/" + repo
+	}
+	return candidates, nil
+}
+
+// Record remembers that repo resolved to resolvedRef, so later Candidates
+// calls for the same short name return it directly instead of re-running
+// the alias/search-registry lookup. Safe to call concurrently with
+// Candidates, e.g. from a Pull racing a concurrent GetReposTags walk.
+func (r *Resolver) Record(repo, resolvedRef string) {
+	if r == nil {
+		return
+	}
+	r.resolvedMu.Lock()
+	r.resolved[repo] = resolvedRef
+	r.resolvedMu.Unlock()
+}
@@ -0,0 +1,97 @@
+package shortnames
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCandidatesDisabledPassesThrough(t *testing.T) {
+	r := New(Config{Mode: ModeDisabled})
+	got, err := r.Candidates("nginx")
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	if len(got) != 1 || got[0] != "nginx" {
+		t.Errorf("Candidates() = %v, want [nginx]", got)
+	}
+}
+
+func TestCandidatesAlias(t *testing.T) {
+	r := New(Config{Aliases: map[string]string{"nginx": "mirror.corp/library/nginx"}})
+	got, err := r.Candidates("nginx")
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	if len(got) != 1 || got[0] != "mirror.corp/library/nginx" {
+		t.Errorf("Candidates() = %v, want [mirror.corp/library/nginx]", got)
+	}
+}
+
+func TestCandidatesEnforcingWithoutAliasErrors(t *testing.T) {
+	r := New(Config{Mode: ModeEnforcing})
+	if _, err := r.Candidates("nginx"); err == nil {
+		t.Error("Candidates() in enforcing mode with no alias, err = nil, want error")
+	}
+}
+
+func TestCandidatesPermissiveSearchRegistries(t *testing.T) {
+	r := New(Config{
+		Mode:                        ModePermissive,
+		UnqualifiedSearchRegistries: []string{"mirror.corp", "docker.io"},
+	})
+	got, err := r.Candidates("nginx")
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	want := []string{"mirror.corp/nginx", "docker.io/nginx"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Candidates() = %v, want %v", got, want)
+	}
+}
+
+func TestRecordWinsOverAlias(t *testing.T) {
+	r := New(Config{Aliases: map[string]string{"nginx": "mirror.corp/library/nginx"}})
+	r.Record("nginx", "fallback.corp/library/nginx")
+
+	got, err := r.Candidates("nginx")
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	if len(got) != 1 || got[0] != "fallback.corp/library/nginx" {
+		t.Errorf("Candidates() after Record = %v, want [fallback.corp/library/nginx]", got)
+	}
+}
+
+func TestNilResolverPassesThrough(t *testing.T) {
+	var r *Resolver
+	r.Record("nginx", "mirror.corp/nginx") // must not panic
+
+	got, err := r.Candidates("nginx")
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	if len(got) != 1 || got[0] != "nginx" {
+		t.Errorf("Candidates() on nil resolver = %v, want [nginx]", got)
+	}
+}
+
+// TestConcurrentCandidatesAndRecord exercises Candidates and Record from
+// many goroutines at once, the way a GetReposTags worker pool resolving
+// short names can race a concurrent Pull recording one. Run with -race.
+func TestConcurrentCandidatesAndRecord(t *testing.T) {
+	r := New(Config{UnqualifiedSearchRegistries: []string{"docker.io"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = r.Candidates("nginx")
+		}()
+		go func() {
+			defer wg.Done()
+			r.Record("nginx", "docker.io/nginx")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,301 @@
+// Package signature verifies cosign/Notary-v2-style image signatures against
+// a per-registry-or-repo trust policy, so a Pull can refuse an image whose
+// signature doesn't check out instead of trusting whatever a registry
+// returns.
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Mode selects how a Rule authenticates a signer.
+type Mode string
+
+const (
+	// ModeKey verifies a signature against Rule.PublicKey. This needs no
+	// network access.
+	ModeKey Mode = "key"
+	// ModeKeyless verifies a signature's Fulcio-issued certificate against
+	// Rule.Issuer and Rule.SubjectRegexp instead of a long-lived key.
+	ModeKeyless Mode = "keyless"
+)
+
+// Rule binds a registry-or-repository glob to how signatures for matching
+// images must be authenticated, mirroring cosign's keyless/key trust model.
+type Rule struct {
+	// Pattern is matched against "registry/repository" (no tag or digest)
+	// with path.Match, e.g. "registry.corp/*" or "registry.corp/team/*".
+	Pattern string `toml:"pattern"`
+	Mode    Mode   `toml:"mode"`
+
+	// PublicKey is a PEM-encoded EC or RSA public key, required in key mode.
+	PublicKey string `toml:"public-key"`
+
+	// Issuer and SubjectRegexp constrain the OIDC identity a keyless
+	// signing certificate must carry, required in keyless mode.
+	Issuer        string `toml:"issuer"`
+	SubjectRegexp string `toml:"subject-regexp"`
+
+	// Root is a PEM bundle of trusted Fulcio root (and any intermediate)
+	// certificates, required in keyless mode. Without it a keyless
+	// signature's certificate is just a self-issued claim — anyone can mint
+	// a keypair, self-sign a certificate with whatever Issuer/SubjectRegexp
+	// the policy expects, and sign the payload — so New refuses to
+	// build a keyless rule that doesn't anchor certificates to a root.
+	Root string `toml:"root"`
+}
+
+// Policy is the on-disk shape of a trust-policy TOML file, e.g.
+//
+//	[[rule]]
+//	pattern = "registry.corp/*"
+//	mode = "key"
+//	public-key = """
+//	-----BEGIN PUBLIC KEY-----
+//	...
+//	-----END PUBLIC KEY-----
+//	"""
+type Policy struct {
+	Rule []Rule `toml:"rule"`
+}
+
+type compiledRule struct {
+	Rule
+	key     crypto.PublicKey
+	subject *regexp.Regexp
+	roots   *x509.CertPool
+}
+
+// Verifier matches repos against a loaded Policy and checks signatures
+// against whichever rule matches.
+type Verifier struct {
+	rules []compiledRule
+}
+
+// Load reads a trust-policy TOML file from path.
+func Load(path string) (*Verifier, error) {
+	var policy Policy
+	if _, err := toml.DecodeFile(path, &policy); err != nil {
+		return nil, err
+	}
+	return New(policy)
+}
+
+// New builds a Verifier from an already-parsed Policy, parsing each rule's
+// PublicKey/SubjectRegexp up front so Verify never fails on malformed policy.
+func New(policy Policy) (*Verifier, error) {
+	v := &Verifier{rules: make([]compiledRule, len(policy.Rule))}
+	for i, rule := range policy.Rule {
+		c := compiledRule{Rule: rule}
+
+		switch rule.Mode {
+		case ModeKey:
+			block, _ := pem.Decode([]byte(rule.PublicKey))
+			if block == nil {
+				return nil, fmt.Errorf("signature: rule %q: no PEM block in public-key", rule.Pattern)
+			}
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("signature: rule %q: %w", rule.Pattern, err)
+			}
+			c.key = key
+		case ModeKeyless:
+			if rule.SubjectRegexp != "" {
+				re, err := regexp.Compile(rule.SubjectRegexp)
+				if err != nil {
+					return nil, fmt.Errorf("signature: rule %q: %w", rule.Pattern, err)
+				}
+				c.subject = re
+			}
+
+			if rule.Root == "" {
+				return nil, fmt.Errorf("signature: rule %q: keyless mode requires root (a trusted Fulcio CA bundle)", rule.Pattern)
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM([]byte(rule.Root)) {
+				return nil, fmt.Errorf("signature: rule %q: no certificates found in root", rule.Pattern)
+			}
+			c.roots = roots
+		default:
+			return nil, fmt.Errorf("signature: rule %q: unknown mode %q", rule.Pattern, rule.Mode)
+		}
+
+		v.rules[i] = c
+	}
+	return v, nil
+}
+
+// RuleFor returns the first rule whose pattern matches repo ("registry/repository").
+func (v *Verifier) RuleFor(repo string) (*Rule, bool) {
+	for i := range v.rules {
+		if ok, _ := path.Match(v.rules[i].Pattern, repo); ok {
+			return &v.rules[i].Rule, true
+		}
+	}
+	return nil, false
+}
+
+// Payload is cosign's "simple signing" envelope: the JSON document that gets
+// signed, binding a signature to one specific image reference and digest.
+type Payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// Signature is one signature pulled from a repo's sha256-<digest>.sig tag
+// (cosign convention) or Notary v2 signature referrer: the raw payload that
+// was signed, its signature, and, in keyless mode, the Fulcio-issued signing
+// certificate.
+type Signature struct {
+	Payload []byte
+	Sig     []byte
+	Cert    *x509.Certificate
+}
+
+// Verify checks sigs against repo's matching Rule: a signature's Payload
+// must name digest, and the signature itself must validate under the rule's
+// key (key mode) or the embedded certificate's OIDC identity must satisfy
+// Issuer/SubjectRegexp and chain to the rule's trusted root (keyless mode).
+// It returns the identity that produced the first valid signature found.
+func (v *Verifier) Verify(repo, digest string, sigs []Signature) (signedBy string, err error) {
+	rule, ok := v.RuleFor(repo)
+	if !ok {
+		return "", fmt.Errorf("signature: no policy rule matches %q", repo)
+	}
+
+	var compiled *compiledRule
+	for i := range v.rules {
+		if &v.rules[i].Rule == rule {
+			compiled = &v.rules[i]
+			break
+		}
+	}
+
+	for _, sig := range sigs {
+		var payload Payload
+		if err := json.Unmarshal(sig.Payload, &payload); err != nil {
+			continue
+		}
+		if payload.Critical.Image.DockerManifestDigest != digest {
+			continue
+		}
+
+		switch rule.Mode {
+		case ModeKeyless:
+			signedBy, err = verifyKeyless(compiled, sig)
+		default:
+			signedBy, err = verifyKey(compiled, sig)
+		}
+		if err == nil {
+			return signedBy, nil
+		}
+	}
+
+	return "", fmt.Errorf("signature: no valid %s signature found for %s", rule.Mode, digest)
+}
+
+func verifyKey(rule *compiledRule, sig Signature) (string, error) {
+	hashed := sha256.Sum256(sig.Payload)
+
+	switch key := rule.key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, hashed[:], sig.Sig) {
+			return "", errors.New("signature: ecdsa verification failed")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig.Sig); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("signature: unsupported public key type %T", rule.key)
+	}
+
+	return "key:" + rule.Pattern, nil
+}
+
+func verifyKeyless(rule *compiledRule, sig Signature) (string, error) {
+	if sig.Cert == nil {
+		return "", errors.New("signature: keyless rule but signature has no certificate")
+	}
+
+	if _, err := sig.Cert.Verify(x509.VerifyOptions{
+		Roots:     rule.roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return "", fmt.Errorf("signature: certificate does not chain to a trusted root: %w", err)
+	}
+
+	hashed := sha256.Sum256(sig.Payload)
+	switch key := sig.Cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, hashed[:], sig.Sig) {
+			return "", errors.New("signature: ecdsa verification failed")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig.Sig); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("signature: unsupported certificate key type %T", key)
+	}
+
+	subject := certIdentity(sig.Cert)
+	if rule.subject != nil && !rule.subject.MatchString(subject) {
+		return "", fmt.Errorf("signature: certificate identity %q does not match subject-regexp", subject)
+	}
+	if rule.Issuer != "" && certIssuer(sig.Cert) != rule.Issuer {
+		return "", fmt.Errorf("signature: certificate issuer %q does not match policy", certIssuer(sig.Cert))
+	}
+
+	return subject, nil
+}
+
+// certIdentity returns a Fulcio certificate's signing identity: the first
+// URI or email SAN, which is where cosign keyless certs carry it.
+func certIdentity(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	return cert.Subject.CommonName
+}
+
+// certIssuer returns the OIDC issuer a Fulcio certificate was issued for,
+// stashed in its issuer extension (OID 1.3.6.1.4.1.57264.1.1 in the Fulcio
+// OID scheme) as a DER-encoded UTF8String, the same way sigstore's own
+// cryptoutils.UnmarshalCertificateExtensions reads it.
+func certIssuer(cert *x509.Certificate) string {
+	fulcioIssuerOID := []int{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(fulcioIssuerOID) {
+			continue
+		}
+		var issuer string
+		if _, err := asn1.Unmarshal(ext.Value, &issuer); err != nil {
+			return ""
+		}
+		return issuer
+	}
+	return ""
+}
@@ -0,0 +1,290 @@
+package signature
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var fulcioIssuerOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+
+func mustSignPayload(t *testing.T, key *ecdsa.PrivateKey, payload []byte) []byte {
+	t.Helper()
+	hashed := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hashed[:])
+	if err != nil {
+		t.Fatalf("SignASN1: %v", err)
+	}
+	return sig
+}
+
+func TestVerifyKeyMode(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+
+	v, err := New(Policy{Rule: []Rule{{
+		Pattern:   "registry.corp/*",
+		Mode:      ModeKey,
+		PublicKey: string(pubPEM),
+	}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	digest := "sha256:deadbeef"
+	payload := []byte(`{"critical":{"image":{"docker-manifest-digest":"` + digest + `"}}}`)
+	sig := mustSignPayload(t, key, payload)
+
+	signedBy, err := v.Verify("registry.corp/app", digest, []Signature{{Payload: payload, Sig: sig}})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if signedBy != "key:registry.corp/*" {
+		t.Errorf("signedBy = %q, want %q", signedBy, "key:registry.corp/*")
+	}
+}
+
+func TestVerifyKeyModeWrongDigestRejected(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	pubBytes, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+
+	v, err := New(Policy{Rule: []Rule{{
+		Pattern:   "registry.corp/*",
+		Mode:      ModeKey,
+		PublicKey: string(pubPEM),
+	}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	payload := []byte(`{"critical":{"image":{"docker-manifest-digest":"sha256:other"}}}`)
+	sig := mustSignPayload(t, key, payload)
+
+	if _, err := v.Verify("registry.corp/app", "sha256:deadbeef", []Signature{{Payload: payload, Sig: sig}}); err == nil {
+		t.Error("Verify with mismatched digest, err = nil, want error")
+	}
+}
+
+func TestVerifyNoMatchingRule(t *testing.T) {
+	v, err := New(Policy{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := v.Verify("registry.corp/app", "sha256:deadbeef", nil); err == nil {
+		t.Error("Verify with no rules, err = nil, want error")
+	}
+}
+
+func TestNewKeylessModeWithoutRootErrors(t *testing.T) {
+	if _, err := New(Policy{Rule: []Rule{{Pattern: "registry.corp/*", Mode: ModeKeyless}}}); err == nil {
+		t.Error("New with keyless rule and no root, err = nil, want error")
+	}
+}
+
+// testCA is a self-signed Fulcio-stand-in root used to sign leaf certs in
+// these tests, so keyless verification has something real to chain to.
+type testCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+	pem  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test fulcio root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+
+	return &testCA{
+		key:  key,
+		cert: cert,
+		pem:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+// issue signs a short-lived leaf certificate for key the way Fulcio issues
+// keyless signing certs: a URI SAN carrying the signer identity and an
+// issuer extension carrying a DER-encoded UTF8String, exactly as
+// cryptoutils.UnmarshalCertificateExtensions expects to read it back.
+func (ca *testCA) issue(t *testing.T, key *ecdsa.PrivateKey, identity, issuer string) *x509.Certificate {
+	t.Helper()
+	u, err := url.Parse(identity)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+
+	issuerExt, err := asn1.MarshalWithParams(issuer, "utf8")
+	if err != nil {
+		t.Fatalf("asn1.Marshal: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "sigstore"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{u},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		ExtraExtensions: []pkix.Extension{
+			{Id: fulcioIssuerOID, Value: issuerExt},
+		},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert
+}
+
+func TestCertIssuerAndIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	cert := ca.issue(t, key, "https://github.com/login/oauth", "https://token.actions.githubusercontent.com")
+
+	if got := certIssuer(cert); got != "https://token.actions.githubusercontent.com" {
+		t.Errorf("certIssuer() = %q, want %q", got, "https://token.actions.githubusercontent.com")
+	}
+	if got := certIdentity(cert); got != "https://github.com/login/oauth" {
+		t.Errorf("certIdentity() = %q, want %q", got, "https://github.com/login/oauth")
+	}
+}
+
+func TestVerifyKeylessMode(t *testing.T) {
+	ca := newTestCA(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	cert := ca.issue(t, key, "https://github.com/org/repo", "https://token.actions.githubusercontent.com")
+
+	v, err := New(Policy{Rule: []Rule{{
+		Pattern:       "registry.corp/*",
+		Mode:          ModeKeyless,
+		Issuer:        "https://token.actions.githubusercontent.com",
+		SubjectRegexp: "^https://github.com/org/.*$",
+		Root:          ca.pem,
+	}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	digest := "sha256:deadbeef"
+	payload := []byte(`{"critical":{"image":{"docker-manifest-digest":"` + digest + `"}}}`)
+	sig := mustSignPayload(t, key, payload)
+
+	signedBy, err := v.Verify("registry.corp/app", digest, []Signature{{Payload: payload, Sig: sig, Cert: cert}})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if signedBy != "https://github.com/org/repo" {
+		t.Errorf("signedBy = %q, want %q", signedBy, "https://github.com/org/repo")
+	}
+}
+
+func TestVerifyKeylessModeWrongIssuerRejected(t *testing.T) {
+	ca := newTestCA(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	cert := ca.issue(t, key, "https://github.com/org/repo", "https://evil.example.com")
+
+	v, err := New(Policy{Rule: []Rule{{
+		Pattern: "registry.corp/*",
+		Mode:    ModeKeyless,
+		Issuer:  "https://token.actions.githubusercontent.com",
+		Root:    ca.pem,
+	}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	digest := "sha256:deadbeef"
+	payload := []byte(`{"critical":{"image":{"docker-manifest-digest":"` + digest + `"}}}`)
+	sig := mustSignPayload(t, key, payload)
+
+	if _, err := v.Verify("registry.corp/app", digest, []Signature{{Payload: payload, Sig: sig, Cert: cert}}); err == nil {
+		t.Error("Verify with mismatched issuer, err = nil, want error")
+	}
+}
+
+// TestVerifyKeylessModeUntrustedCertRejected is the regression case for a
+// forged keyless signature: a certificate claiming whatever issuer/subject
+// the policy expects, issued by a CA with no relation to the configured
+// root, must not verify.
+func TestVerifyKeylessModeUntrustedCertRejected(t *testing.T) {
+	trustedCA := newTestCA(t)
+	forgedCA := newTestCA(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	cert := forgedCA.issue(t, key, "https://github.com/org/repo", "https://token.actions.githubusercontent.com")
+
+	v, err := New(Policy{Rule: []Rule{{
+		Pattern:       "registry.corp/*",
+		Mode:          ModeKeyless,
+		Issuer:        "https://token.actions.githubusercontent.com",
+		SubjectRegexp: "^https://github.com/org/.*$",
+		Root:          trustedCA.pem,
+	}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	digest := "sha256:deadbeef"
+	payload := []byte(`{"critical":{"image":{"docker-manifest-digest":"` + digest + `"}}}`)
+	sig := mustSignPayload(t, key, payload)
+
+	if _, err := v.Verify("registry.corp/app", digest, []Signature{{Payload: payload, Sig: sig, Cert: cert}}); err == nil {
+		t.Error("Verify with a cert chaining to an untrusted root, err = nil, want error")
+	}
+}